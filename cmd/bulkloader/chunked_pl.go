@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/binary"
+	"flag"
+	"math/bits"
+	"math/rand"
+
+	"github.com/dgraph-io/badger"
+	"github.com/dgraph-io/dgraph/bp128"
+	"github.com/dgraph-io/dgraph/protos"
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// enableChunkedPostingLists gates the chunked (UserMeta=0x02) layout below.
+// It defaults to off: the query-serving binary that reads Badger values
+// back out lives outside this tree and, as of this change, still only
+// understands the pre-existing 0x00/0x01 layouts. Flipping this on before
+// that binary is taught to read chunkIndex values (via the same logic as
+// ReadPostingListUids below) means every predicate that crosses
+// chunkUidThreshold() gets written in a layout the query path will
+// misinterpret as a flat delta-packed UID list. Loaders and serving nodes
+// must be upgraded together.
+var enableChunkedPostingLists = flag.Bool("chunk_posting_lists", false,
+	"EXPERIMENTAL: split huge UID-only posting lists into content-defined "+
+		"chunks. Requires a query-serving binary that understands the "+
+		"chunked layout; do not enable otherwise.")
+
+// chunkUidThresholdFlag is the configurable threshold backing
+// chunkUidThreshold(): the UID count above which outputPostingList splits a
+// UID-only posting list into content-defined chunks instead of emitting it
+// as a single bp128-packed value. Operators tune this per data/cluster
+// shape without a rebuild.
+var chunkUidThresholdFlag = flag.Int64("chunk_posting_list_threshold", 1<<20,
+	"UID count above which --chunk_posting_lists splits a posting list into "+
+		"content-defined chunks.")
+
+func chunkUidThreshold() int {
+	return int(*chunkUidThresholdFlag)
+}
+
+// UserMeta values for the two posting list layouts outputPostingList can
+// produce once a list grows past chunkUidThreshold(). 0x00 (full
+// protos.PostingList) and 0x01 (flat delta-packed UID list) are the
+// pre-existing layouts; this file only adds 0x02.
+const (
+	// metaChunkIndex marks a value as a chunkIndex rather than posting
+	// data: the key holds no postings itself, just a pointer to the chunk
+	// keys that do.
+	metaChunkIndex = 0x02
+
+	// minChunkUids/maxChunkUids bound how small/large a single
+	// content-defined chunk can be, so a pathological UID stream (e.g. one
+	// that never produces a cut) can't produce a degenerate chunking.
+	minChunkUids = 1 << 13 // ~8K
+	maxChunkUids = 1 << 19 // ~512K
+
+	// rollWindowBytes is the width of the rolling-hash window: 64 bytes,
+	// i.e. 8 UIDs, as suggested by the typical content-defined-chunking
+	// window size.
+	rollWindowBytes = 64
+
+	// cutMask is tested against the low bits of the rolling hash; a cut is
+	// declared when they're all zero. Its bit count sets the expected
+	// distance to the next hash cut (2^13 uids here). Hash cuts that come
+	// before minChunkUids are ignored, so the average chunk is about
+	// minChunkUids + 2^13 uids (~16K), capped at maxChunkUids.
+	cutMask = 1<<13 - 1
+)
+
+// buzhashTable is a fixed table of random 64-bit words used by the
+// cyclic-polynomial (Buzhash-style) rolling hash in cutPoints. It's seeded
+// with a fixed constant rather than the process's default source so that
+// cut points -- and hence chunk boundaries -- are stable across runs and
+// across machines; that stability is what lets reloading the same
+// predicate produce mostly-identical chunks for content-addressed dedup.
+var buzhashTable [256]uint64
+
+func init() {
+	var seed uint64 = 0x9e3779b97f4a7c15 // fixed golden-ratio constant, reinterpreted as int64 below
+	r := rand.New(rand.NewSource(int64(seed)))
+	for i := range buzhashTable {
+		buzhashTable[i] = r.Uint64()
+	}
+}
+
+// cutPoints returns the indices into uids (exclusive ends of each chunk)
+// at which outputPostingList should split the UID stream, using a rolling
+// hash over the big-endian byte encoding of the UIDs. A cut is taken where
+// the low bits of the hash computed over the trailing rollWindowBytes are
+// all zero, subject to minChunkUids/maxChunkUids. Because the cuts depend
+// only on the content of the UID stream (not on its length or position),
+// re-chunking the same predicate after a small delta reproduces most of
+// the previous chunk boundaries untouched.
+func cutPoints(uids []uint64) []int {
+	var (
+		h      uint64
+		window [rollWindowBytes]byte
+		pos    int
+		filled int
+		cuts   []int
+		start  int
+		buf    [8]byte
+	)
+
+	for i, uid := range uids {
+		binary.BigEndian.PutUint64(buf[:], uid)
+		for _, b := range buf {
+			if filled < rollWindowBytes {
+				h = bits.RotateLeft64(h, 1) ^ buzhashTable[b]
+				filled++
+			} else {
+				out := window[pos]
+				h = bits.RotateLeft64(h, 1) ^ buzhashTable[out] ^ buzhashTable[b]
+			}
+			window[pos] = b
+			pos = (pos + 1) % rollWindowBytes
+		}
+
+		chunkLen := i + 1 - start
+		atHashCut := filled >= rollWindowBytes && h&cutMask == 0
+		if (atHashCut && chunkLen >= minChunkUids) || chunkLen >= maxChunkUids {
+			cuts = append(cuts, i+1)
+			start = i + 1
+			h, filled, pos = 0, 0, 0
+		}
+	}
+	if start < len(uids) {
+		cuts = append(cuts, len(uids))
+	}
+	return cuts
+}
+
+// chunkKey derives the key a chunk of plKey is stored under: the original
+// posting list key with the chunk's index appended.
+func chunkKey(plKey []byte, chunkIdx int) []byte {
+	k := make([]byte, len(plKey)+4)
+	copy(k, plKey)
+	binary.BigEndian.PutUint32(k[len(plKey):], uint32(chunkIdx))
+	return k
+}
+
+// chunkIndexEntry is one record of a chunkIndex: the inclusive UID range
+// covered by a chunk, and the key it's stored under.
+type chunkIndexEntry struct {
+	minUid, maxUid uint64
+	key            []byte
+}
+
+// marshalChunkIndex encodes entries as: uvarint count, then per entry
+// minUid, maxUid, uvarint(len(key)), key.
+func marshalChunkIndex(entries []chunkIndexEntry) []byte {
+	sz := binary.MaxVarintLen64
+	for _, e := range entries {
+		sz += 8 + 8 + binary.MaxVarintLen64 + len(e.key)
+	}
+	buf := make([]byte, sz)
+	n := binary.PutUvarint(buf, uint64(len(entries)))
+	for _, e := range entries {
+		binary.BigEndian.PutUint64(buf[n:], e.minUid)
+		n += 8
+		binary.BigEndian.PutUint64(buf[n:], e.maxUid)
+		n += 8
+		n += binary.PutUvarint(buf[n:], uint64(len(e.key)))
+		n += copy(buf[n:], e.key)
+	}
+	return buf[:n]
+}
+
+// unmarshalChunkIndex is the inverse of marshalChunkIndex.
+func unmarshalChunkIndex(buf []byte) []chunkIndexEntry {
+	count, n := binary.Uvarint(buf)
+	entries := make([]chunkIndexEntry, count)
+	for i := range entries {
+		e := &entries[i]
+		e.minUid = binary.BigEndian.Uint64(buf[n:])
+		n += 8
+		e.maxUid = binary.BigEndian.Uint64(buf[n:])
+		n += 8
+		klen, m := binary.Uvarint(buf[n:])
+		n += m
+		e.key = buf[n : n+int(klen)]
+		n += int(klen)
+	}
+	return entries
+}
+
+// writeChunkedPostingList splits uids into content-defined chunks, writes
+// each chunk out under its own derived key via entries, and returns the
+// chunkIndex value to store under plKey itself (with metaChunkIndex).
+func writeChunkedPostingList(plKey []byte, uids []uint64,
+	getEntry func() *badger.Entry) []byte {
+
+	var chunkEntries []chunkIndexEntry
+	start := 0
+	for chunkIdx, end := range cutPoints(uids) {
+		chunk := uids[start:end]
+		k := chunkKey(plKey, chunkIdx)
+
+		e := getEntry()
+		e.Key = k
+		e.Value = bp128.DeltaPack(chunk)
+		e.UserMeta = 0x01 // flat delta-packed UID list, same as the unchunked layout
+
+		chunkEntries = append(chunkEntries, chunkIndexEntry{
+			minUid: chunk[0],
+			maxUid: chunk[len(chunk)-1],
+			key:    k,
+		})
+		start = end
+	}
+	return marshalChunkIndex(chunkEntries)
+}
+
+// ReadPostingListUids transparently reassembles the UID list for key,
+// whichever layout outputPostingList used to write it: a full
+// protos.PostingList (0x00), a flat delta-packed UID list (0x01) or a
+// chunkIndex (metaChunkIndex).
+//
+// NOTE: this lives in the bulk loader's own package main and cannot be
+// imported by the separate query-serving binary, so it is not actually
+// wired into any query code path yet -- it only backs this package's own
+// tests and documents what that binary's reader needs to do once ported.
+// That porting work is the blocking dependency for enableChunkedPostingLists
+// above; don't flip that flag on in production until it's done.
+func ReadPostingListUids(kv *badger.KV, key []byte) ([]uint64, error) {
+	var item badger.KVItem
+	if err := kv.Get(key, &item); err != nil {
+		return nil, err
+	}
+	if item.UserMeta() == 0x00 {
+		pl := new(protos.PostingList)
+		if err := pl.Unmarshal(item.Value()); err != nil {
+			return nil, err
+		}
+		return bp128.DeltaUnpack(pl.Uids), nil
+	}
+	if item.UserMeta() != metaChunkIndex {
+		return bp128.DeltaUnpack(item.Value()), nil
+	}
+
+	entries := unmarshalChunkIndex(item.Value())
+	var uids []uint64
+	for _, e := range entries {
+		var chunkItem badger.KVItem
+		if err := kv.Get(e.key, &chunkItem); err != nil {
+			return nil, err
+		}
+		x.AssertTruef(chunkItem.UserMeta() == 0x01, "expected flat chunk layout")
+		uids = append(uids, bp128.DeltaUnpack(chunkItem.Value())...)
+	}
+	return uids, nil
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/dgraph-io/badger"
+)
+
+func sequentialUids(n int) []uint64 {
+	uids := make([]uint64, n)
+	for i := range uids {
+		uids[i] = uint64(i) * 3 // not all dense, to exercise the byte encoding
+	}
+	return uids
+}
+
+func TestCutPointsCoversWholeStreamWithinBounds(t *testing.T) {
+	uids := sequentialUids(3 * maxChunkUids)
+	cuts := cutPoints(uids)
+
+	if len(cuts) == 0 {
+		t.Fatal("expected at least one cut for a stream this large")
+	}
+
+	start := 0
+	for i, end := range cuts {
+		if end <= start {
+			t.Fatalf("cut %d: end %d <= start %d", i, end, start)
+		}
+		chunkLen := end - start
+		last := i == len(cuts)-1
+		if chunkLen > maxChunkUids {
+			t.Fatalf("cut %d: chunk length %d exceeds maxChunkUids %d", i, chunkLen, maxChunkUids)
+		}
+		// Only a non-final chunk is guaranteed to have hit minChunkUids;
+		// the last chunk is whatever's left over.
+		if !last && chunkLen < minChunkUids {
+			t.Fatalf("cut %d: chunk length %d below minChunkUids %d", i, chunkLen, minChunkUids)
+		}
+		start = end
+	}
+	if start != len(uids) {
+		t.Fatalf("cuts cover %d uids, want %d", start, len(uids))
+	}
+}
+
+func TestCutPointsDeterministic(t *testing.T) {
+	uids := sequentialUids(4 * minChunkUids)
+	a := cutPoints(uids)
+	b := cutPoints(append([]uint64(nil), uids...))
+	if !reflect.DeepEqual(a, b) {
+		t.Fatalf("cutPoints isn't deterministic: %v vs %v", a, b)
+	}
+}
+
+func TestCutPointsStableUnderAppend(t *testing.T) {
+	// Content-defined chunking's whole point: appending data to the end of
+	// the stream shouldn't change where the earlier cuts fall.
+	base := sequentialUids(4 * minChunkUids)
+	extended := append(append([]uint64(nil), base...), sequentialUids(minChunkUids)...)
+
+	baseCuts := cutPoints(base)
+	extendedCuts := cutPoints(extended)
+
+	if len(baseCuts) == 0 || len(extendedCuts) < len(baseCuts) {
+		t.Fatalf("expected extended stream to have at least as many cuts: base=%v extended=%v",
+			baseCuts, extendedCuts)
+	}
+	for i := 0; i < len(baseCuts)-1; i++ {
+		if baseCuts[i] != extendedCuts[i] {
+			t.Fatalf("cut %d moved after appending: base=%d extended=%d", i, baseCuts[i], extendedCuts[i])
+		}
+	}
+}
+
+func TestMarshalUnmarshalChunkIndexRoundTrip(t *testing.T) {
+	entries := []chunkIndexEntry{
+		{minUid: 0, maxUid: 99, key: []byte("key-chunk-0")},
+		{minUid: 100, maxUid: 4095, key: []byte("key-chunk-1")},
+		{minUid: 4096, maxUid: 4096, key: []byte("k2")},
+	}
+
+	got := unmarshalChunkIndex(marshalChunkIndex(entries))
+	if len(got) != len(entries) {
+		t.Fatalf("got %d entries, want %d", len(got), len(entries))
+	}
+	for i := range entries {
+		if got[i].minUid != entries[i].minUid || got[i].maxUid != entries[i].maxUid ||
+			string(got[i].key) != string(entries[i].key) {
+			t.Fatalf("entry %d: got %+v, want %+v", i, got[i], entries[i])
+		}
+	}
+}
+
+func TestWriteChunkedPostingListReassemble(t *testing.T) {
+	dir, err := ioutil.TempDir("", "chunked_pl_test")
+	if err != nil {
+		t.Fatalf("TempDir: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	opt := badger.DefaultOptions
+	opt.Dir, opt.ValueDir = dir, dir
+	kv, err := badger.NewKV(&opt)
+	if err != nil {
+		t.Fatalf("badger.NewKV: %v", err)
+	}
+	defer kv.Close()
+
+	plKey := []byte("predicate|some-key")
+	uids := sequentialUids(3 * maxChunkUids)
+
+	var entries []*badger.Entry
+	indexVal := writeChunkedPostingList(plKey, uids, func() *badger.Entry {
+		e := new(badger.Entry)
+		entries = append(entries, e)
+		return e
+	})
+	entries = append(entries, &badger.Entry{Key: plKey, Value: indexVal, UserMeta: metaChunkIndex})
+
+	if err := kv.BatchSet(entries); err != nil {
+		t.Fatalf("BatchSet: %v", err)
+	}
+	for _, e := range entries {
+		if e.Error != nil {
+			t.Fatalf("entry for key %q: %v", e.Key, e.Error)
+		}
+	}
+
+	got, err := ReadPostingListUids(kv, plKey)
+	if err != nil {
+		t.Fatalf("ReadPostingListUids: %v", err)
+	}
+	if !reflect.DeepEqual(got, uids) {
+		t.Fatalf("reassembled %d uids, want %d (first mismatch expected)", len(got), len(uids))
+	}
+}
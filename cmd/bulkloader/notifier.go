@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var notifyFlag = flag.String("notify", "",
+	"Comma separated list of notification sinks to report bulk-load progress "+
+		"and completion to, e.g. pushover://user:token@?priority=1,webhook://example.com/hook")
+
+// Stats is a point-in-time snapshot of the bulk loader's progress counters,
+// cheap enough to build from the counters reduce/buildPostingLists already
+// maintain on every hot-path update.
+type Stats struct {
+	ReduceKeyCount      int64
+	ReduceEdgeCount     int64
+	NumBadgerWrites     int64
+	NumQueuedReduceJobs int64
+}
+
+// Notifier lets long, unattended bulk-load runs on remote machines be
+// observed without tailing logs: OnPhase fires at phase transitions and
+// periodically within a phase, OnComplete fires once, when the whole load
+// finishes. err carries the failure, if any -- though today's only caller,
+// buildPostingLists, can never actually supply a non-nil one: every error
+// in this pipeline goes through x.Check, which exits the process before any
+// deferred OnComplete call would run. The err parameter is kept because
+// OnComplete is meant for any caller that does propagate a real error, not
+// just the current one.
+type Notifier interface {
+	OnPhase(phase string, stats Stats)
+	OnComplete(err error, stats Stats)
+}
+
+// notifyEveryNBatches controls how often, within a phase, OnPhase is called
+// again to report progress -- frequently enough to be useful on a
+// multi-hour load, rarely enough that it's not itself a bottleneck.
+const notifyEveryNBatches = 1000
+
+// statsSnapshot builds a Stats from the atomics reduce already maintains on
+// every edge/key, plus the package-level write/queue-depth counters. It
+// does no extra allocation or locking beyond the atomic loads themselves.
+func statsSnapshot(prog *progress) Stats {
+	return Stats{
+		ReduceKeyCount:      atomic.LoadInt64(&prog.reduceKeyCount),
+		ReduceEdgeCount:     atomic.LoadInt64(&prog.reduceEdgeCount),
+		NumBadgerWrites:     NumBadgerWrites.Value(),
+		NumQueuedReduceJobs: NumQueuedReduceJobs.Value(),
+	}
+}
+
+// multiNotifier fans a single call out to every configured sink, so an
+// operator can subscribe more than one (e.g. Slack for humans, webhook for
+// an internal dashboard) via a single --notify flag.
+type multiNotifier struct {
+	notifiers []Notifier
+}
+
+func (m multiNotifier) OnPhase(phase string, stats Stats) {
+	for _, n := range m.notifiers {
+		n.OnPhase(phase, stats)
+	}
+}
+
+func (m multiNotifier) OnComplete(err error, stats Stats) {
+	for _, n := range m.notifiers {
+		n.OnComplete(err, stats)
+	}
+}
+
+// noopNotifier is used when --notify isn't set.
+type noopNotifier struct{}
+
+func (noopNotifier) OnPhase(string, Stats)   {}
+func (noopNotifier) OnComplete(error, Stats) {}
+
+// notifierFromFlags parses --notify into a Notifier. An empty flag yields a
+// noopNotifier so call sites never need to nil-check.
+func notifierFromFlags() Notifier {
+	return parseNotifiers(*notifyFlag)
+}
+
+func parseNotifiers(spec string) Notifier {
+	if spec == "" {
+		return noopNotifier{}
+	}
+
+	var notifiers []Notifier
+	for _, part := range strings.Split(spec, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		n, err := parseNotifier(part)
+		if err != nil {
+			log.Printf("bulkloader: ignoring --notify sink %q: %v", part, err)
+			continue
+		}
+		notifiers = append(notifiers, n)
+	}
+	return multiNotifier{notifiers}
+}
+
+func parseNotifier(uri string) (Notifier, error) {
+	u, err := url.Parse(uri)
+	if err != nil {
+		return nil, err
+	}
+
+	switch u.Scheme {
+	case "webhook", "http", "https":
+		u.Scheme = strings.Replace(u.Scheme, "webhook", "https", 1)
+		return &webhookNotifier{url: u.String()}, nil
+	case "slack":
+		// slack://hooks.slack.com/services/T000/B000/XXX -> https://hooks.slack.com/services/T000/B000/XXX
+		u.Scheme = "https"
+		return &slackNotifier{webhookURL: u.String()}, nil
+	case "pushover":
+		return newPushoverNotifier(u)
+	default:
+		return nil, fmt.Errorf("unknown notify scheme %q", u.Scheme)
+	}
+}
+
+// notifyHTTPClient bounds every notifier HTTP call so a slow or unreachable
+// sink can't stall the reduce/buildPostingLists goroutine calling OnPhase
+// inline on the hot path.
+var notifyHTTPClient = &http.Client{Timeout: 10 * time.Second}
+
+func postJSON(url string, body interface{}) error {
+	buf, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := notifyHTTPClient.Post(url, "application/json", bytes.NewReader(buf))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("notify: %s returned status %s", url, resp.Status)
+	}
+	return nil
+}
+
+// webhookNotifier POSTs a JSON payload describing the event to an arbitrary
+// HTTP endpoint, for operators wiring bulk-load progress into their own
+// dashboards.
+type webhookNotifier struct {
+	url string
+}
+
+type webhookPayload struct {
+	Phase string `json:"phase,omitempty"`
+	Done  bool   `json:"done"`
+	Error string `json:"error,omitempty"`
+	Stats Stats  `json:"stats"`
+}
+
+func (w *webhookNotifier) OnPhase(phase string, stats Stats) {
+	if err := postJSON(w.url, webhookPayload{Phase: phase, Stats: stats}); err != nil {
+		log.Printf("bulkloader: webhook notify failed: %v", err)
+	}
+}
+
+func (w *webhookNotifier) OnComplete(err error, stats Stats) {
+	p := webhookPayload{Done: true, Stats: stats}
+	if err != nil {
+		p.Error = err.Error()
+	}
+	if postErr := postJSON(w.url, p); postErr != nil {
+		log.Printf("bulkloader: webhook notify failed: %v", postErr)
+	}
+}
+
+// slackNotifier posts a short human-readable message to a Slack incoming
+// webhook.
+type slackNotifier struct {
+	webhookURL string
+}
+
+func (s *slackNotifier) post(text string) {
+	body := struct {
+		Text string `json:"text"`
+	}{text}
+	if err := postJSON(s.webhookURL, body); err != nil {
+		log.Printf("bulkloader: slack notify failed: %v", err)
+	}
+}
+
+func (s *slackNotifier) OnPhase(phase string, stats Stats) {
+	s.post(fmt.Sprintf("bulk load: phase=%s keys=%d edges=%d pendingWrites=%d queuedJobs=%d",
+		phase, stats.ReduceKeyCount, stats.ReduceEdgeCount,
+		stats.NumBadgerWrites, stats.NumQueuedReduceJobs))
+}
+
+func (s *slackNotifier) OnComplete(err error, stats Stats) {
+	if err != nil {
+		s.post(fmt.Sprintf("bulk load failed: %v (keys=%d edges=%d)",
+			err, stats.ReduceKeyCount, stats.ReduceEdgeCount))
+		return
+	}
+	s.post(fmt.Sprintf("bulk load complete: keys=%d edges=%d",
+		stats.ReduceKeyCount, stats.ReduceEdgeCount))
+}
+
+// pushoverNotifier sends push notifications via Pushover
+// (https://pushover.net). Emergency priority messages are retried by
+// Pushover's servers until acknowledged or expire elapses. The priority set
+// on the --notify URI applies to every message this notifier sends, the
+// periodic OnPhase reports as well as OnComplete.
+type pushoverNotifier struct {
+	userKey  string
+	appToken string
+	priority int
+	retry    time.Duration
+	expire   time.Duration
+}
+
+func newPushoverNotifier(u *url.URL) (*pushoverNotifier, error) {
+	appToken, _ := u.User.Password()
+	p := &pushoverNotifier{
+		userKey:  u.User.Username(),
+		appToken: appToken,
+		retry:    30 * time.Second,
+		expire:   time.Hour,
+	}
+	if p.userKey == "" || p.appToken == "" {
+		return nil, fmt.Errorf("pushover URI must be pushover://user:token@")
+	}
+
+	q := u.Query()
+	if v := q.Get("priority"); v != "" {
+		prio, err := strconv.Atoi(v)
+		if err != nil {
+			return nil, fmt.Errorf("pushover priority: %v", err)
+		}
+		p.priority = prio
+	}
+	if v := q.Get("retry"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("pushover retry: %v", err)
+		}
+		p.retry = d
+	}
+	if v := q.Get("expire"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("pushover expire: %v", err)
+		}
+		p.expire = d
+	}
+	return p, nil
+}
+
+func (p *pushoverNotifier) send(message string) {
+	form := url.Values{
+		"token":   {p.appToken},
+		"user":    {p.userKey},
+		"message": {message},
+	}
+	if p.priority != 0 {
+		form.Set("priority", strconv.Itoa(p.priority))
+	}
+	// Emergency priority (2) requires retry/expire so Pushover knows how
+	// often to re-alert and when to give up.
+	if p.priority == 2 {
+		form.Set("retry", strconv.Itoa(int(p.retry.Seconds())))
+		form.Set("expire", strconv.Itoa(int(p.expire.Seconds())))
+	}
+
+	resp, err := notifyHTTPClient.PostForm("https://api.pushover.net/1/messages.json", form)
+	if err != nil {
+		log.Printf("bulkloader: pushover notify failed: %v", err)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("bulkloader: pushover notify failed: status %s", resp.Status)
+	}
+}
+
+func (p *pushoverNotifier) OnPhase(phase string, stats Stats) {
+	p.send(fmt.Sprintf("phase=%s keys=%d edges=%d", phase, stats.ReduceKeyCount, stats.ReduceEdgeCount))
+}
+
+func (p *pushoverNotifier) OnComplete(err error, stats Stats) {
+	if err != nil {
+		p.send(fmt.Sprintf("bulk load failed: %v", err))
+		return
+	}
+	p.send(fmt.Sprintf("bulk load complete: keys=%d edges=%d", stats.ReduceKeyCount, stats.ReduceEdgeCount))
+}
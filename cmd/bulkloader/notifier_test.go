@@ -0,0 +1,93 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseNotifierPushover(t *testing.T) {
+	n, err := parseNotifier("pushover://myuser:myapptoken@?priority=2&retry=45s&expire=2h")
+	if err != nil {
+		t.Fatalf("parseNotifier: %v", err)
+	}
+	p, ok := n.(*pushoverNotifier)
+	if !ok {
+		t.Fatalf("got %T, want *pushoverNotifier", n)
+	}
+	if p.userKey != "myuser" {
+		t.Errorf("userKey = %q, want %q", p.userKey, "myuser")
+	}
+	if p.appToken != "myapptoken" {
+		t.Errorf("appToken = %q, want %q", p.appToken, "myapptoken")
+	}
+	if p.priority != 2 {
+		t.Errorf("priority = %d, want 2", p.priority)
+	}
+	if p.retry != 45*time.Second {
+		t.Errorf("retry = %v, want 45s", p.retry)
+	}
+	if p.expire != 2*time.Hour {
+		t.Errorf("expire = %v, want 2h", p.expire)
+	}
+}
+
+func TestParseNotifierPushoverRequiresUserAndToken(t *testing.T) {
+	if _, err := parseNotifier("pushover://"); err == nil {
+		t.Fatal("expected an error for a pushover URI with no user/token")
+	}
+	if _, err := parseNotifier("pushover://user@"); err == nil {
+		t.Fatal("expected an error for a pushover URI with no token")
+	}
+}
+
+func TestParseNotifierWebhook(t *testing.T) {
+	n, err := parseNotifier("webhook://example.com/hook")
+	if err != nil {
+		t.Fatalf("parseNotifier: %v", err)
+	}
+	w, ok := n.(*webhookNotifier)
+	if !ok {
+		t.Fatalf("got %T, want *webhookNotifier", n)
+	}
+	if w.url != "https://example.com/hook" {
+		t.Errorf("url = %q, want %q", w.url, "https://example.com/hook")
+	}
+}
+
+func TestParseNotifierSlack(t *testing.T) {
+	n, err := parseNotifier("slack://hooks.slack.com/services/T000/B000/XXX")
+	if err != nil {
+		t.Fatalf("parseNotifier: %v", err)
+	}
+	s, ok := n.(*slackNotifier)
+	if !ok {
+		t.Fatalf("got %T, want *slackNotifier", n)
+	}
+	want := "https://hooks.slack.com/services/T000/B000/XXX"
+	if s.webhookURL != want {
+		t.Errorf("webhookURL = %q, want %q", s.webhookURL, want)
+	}
+}
+
+func TestParseNotifierUnknownScheme(t *testing.T) {
+	if _, err := parseNotifier("ftp://example.com"); err == nil {
+		t.Fatal("expected an error for an unsupported scheme")
+	}
+}
+
+func TestParseNotifiersSkipsBadSinksButKeepsGoodOnes(t *testing.T) {
+	n := parseNotifiers("ftp://bad,webhook://example.com/hook")
+	m, ok := n.(multiNotifier)
+	if !ok {
+		t.Fatalf("got %T, want multiNotifier", n)
+	}
+	if len(m.notifiers) != 1 {
+		t.Fatalf("got %d notifiers, want 1 (the bad sink should be skipped, not fatal)", len(m.notifiers))
+	}
+}
+
+func TestParseNotifiersEmptySpecIsNoop(t *testing.T) {
+	if _, ok := parseNotifiers("").(noopNotifier); !ok {
+		t.Fatalf("parseNotifiers(\"\") should be a noopNotifier")
+	}
+}
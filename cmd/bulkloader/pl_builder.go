@@ -13,17 +13,23 @@ import (
 	"github.com/dgraph-io/dgraph/x"
 )
 
-func newPlBuilder(tmpDir string) *plBuilder {
+// newPlBuilder creates a plBuilder whose scratch Badger instance lives under
+// tmpDir on local disk; Badger needs real POSIX files, so this is true even
+// when store is a remote spillStore. store is kept around so a future
+// incremental-load mode can check it for map output already spilled by a
+// previous, interrupted run of this predicate.
+func newPlBuilder(store spillStore, tmpDir string) *plBuilder {
 	badgerDir, err := ioutil.TempDir(tmpDir, "dgraph_bulkloader")
 	x.Check(err)
 	kv, err := defaultBadger(badgerDir)
 	x.Check(err)
-	return &plBuilder{kv, badgerDir}
+	return &plBuilder{kv, badgerDir, store}
 }
 
 type plBuilder struct {
 	kv        *badger.KV
 	badgerDir string
+	store     spillStore
 }
 
 func (b *plBuilder) cleanUp() {
@@ -61,9 +67,20 @@ func (b *plBuilder) addPosting(postingListKey []byte, posting *protos.Posting) {
 	x.Check(b.kv.Set(key, val, meta))
 }
 
-func (b *plBuilder) buildPostingLists(target *badger.KV, ss schemaStore) {
+func (b *plBuilder) buildPostingLists(target *badger.KV, ss schemaStore, notifier Notifier) {
 
 	counts := map[int][]uint64{}
+	var builtKeyCount int64
+
+	notifier.OnPhase("build_posting_lists", Stats{})
+	// err is always nil here: every failure in this pipeline goes through
+	// x.Check, which calls log.Fatal and exits before this deferred func
+	// would run, so OnComplete never actually observes a failure from this
+	// call site. See the Notifier doc comment for why that's still the
+	// right interface for callers that do propagate a real error.
+	defer func() {
+		notifier.OnComplete(nil, Stats{ReduceKeyCount: builtKeyCount})
+	}()
 
 	pl := &protos.PostingList{}
 	uids := []uint64{}
@@ -134,6 +151,11 @@ func (b *plBuilder) buildPostingLists(target *badger.KV, ss schemaStore) {
 				counts[cnt] = append(counts[cnt], parsedK.Uid)
 			}
 
+			builtKeyCount++
+			if builtKeyCount%notifyEveryNBatches == 0 {
+				notifier.OnPhase("build_posting_lists", Stats{ReduceKeyCount: builtKeyCount})
+			}
+
 			// Reset for next posting list.
 			pl.Postings = nil
 			pl.Uids = nil
@@ -185,4 +207,4 @@ func extractPLKey(kvKey []byte) []byte {
 
 func extractUID(kvKey []byte) uint64 {
 	return binary.BigEndian.Uint64(kvKey[len(kvKey)-8:])
-}
\ No newline at end of file
+}
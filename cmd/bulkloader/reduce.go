@@ -7,7 +7,6 @@ import (
 	"encoding/binary"
 	"io"
 	"log"
-	"os"
 	"sync"
 	"sync/atomic"
 
@@ -34,8 +33,8 @@ var plBufPool = sync.Pool{
 	},
 }
 
-func readMapOutput(filename string, mapEntryCh chan<- *protos.MapEntry) {
-	fd, err := os.Open(filename)
+func readMapOutput(store spillStore, filename string, mapEntryCh chan<- *protos.MapEntry) {
+	fd, err := store.Open(filename)
 	x.Check(err)
 	defer fd.Close()
 	r := bufio.NewReaderSize(fd, 16<<10)
@@ -128,8 +127,12 @@ func (h *postingHeap) Pop() interface{} {
 	return elem
 }
 
+// reduceBatchSeq counts calls to reduce across all workers, so notifier can
+// be pinged once every notifyEveryNBatches batches instead of on every one.
+var reduceBatchSeq int64
+
 func reduce(batch []*protos.MapEntry, kv *badger.KV,
-	prog *progress, pendingBadgerWrites chan struct{}) {
+	prog *progress, pendingBadgerWrites chan struct{}, notifier Notifier) {
 
 	var currentKey []byte
 	var uids []uint64
@@ -146,7 +149,18 @@ func reduce(batch []*protos.MapEntry, kv *badger.KV,
 		// delta packed UID list).
 		e := entPool.Get().(*badger.Entry)
 		e.Key = currentKey
-		if len(pl.Postings) == 0 {
+		if len(pl.Postings) == 0 && len(uids) > chunkUidThreshold() && *enableChunkedPostingLists {
+			// Hot predicates can produce posting lists with tens of millions
+			// of UIDs; splitting them into content-defined chunks keeps any
+			// single Badger value small and lets an incremental reload of
+			// the same predicate reuse most of the previous chunks.
+			e.Value = writeChunkedPostingList(currentKey, uids, func() *badger.Entry {
+				ce := entPool.Get().(*badger.Entry)
+				entries = append(entries, ce)
+				return ce
+			})
+			e.UserMeta = metaChunkIndex
+		} else if len(pl.Postings) == 0 {
 			e.Value = bp128.DeltaPack(uids)
 			e.UserMeta = 0x01
 		} else {
@@ -184,6 +198,10 @@ func reduce(batch []*protos.MapEntry, kv *badger.KV,
 	}
 	outputPostingList()
 
+	if atomic.AddInt64(&reduceBatchSeq, 1)%notifyEveryNBatches == 0 {
+		notifier.OnPhase("reduce", statsSnapshot(prog))
+	}
+
 	pendingBadgerWrites <- struct{}{}
 	NumBadgerWrites.Add(1)
 	kv.BatchSetAsync(entries, func(err error) {
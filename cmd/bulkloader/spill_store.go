@@ -0,0 +1,97 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// spillReadSeekCloser is the interface returned by spillStore.Open. Local
+// files already satisfy it; remote backends satisfy it by staging onto a
+// TempFileSeeker when the underlying object doesn't support native Seek.
+type spillReadSeekCloser interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// spillStore abstracts the storage backend used for the bulk loader's
+// intermediate map/reduce output, so the shuffle/reduce phase isn't forced
+// to fit entirely on the scratch disk of the machine running the loader.
+// A local-disk implementation is the default; the S3 and GCS
+// implementations (s3SpillStore, gcsSpillStore) let a loader restart by pointing at an existing
+// bucket of map output instead of a local directory.
+type spillStore interface {
+	// Create opens name for writing, truncating it if it already exists.
+	Create(name string) (io.WriteCloser, error)
+	// Open opens name for reading.
+	Open(name string) (spillReadSeekCloser, error)
+	// Remove deletes name. It is not an error if name doesn't exist.
+	Remove(name string) error
+	// List returns the names of all objects under prefix, sorted.
+	List(prefix string) ([]string, error)
+}
+
+// localSpillStore is a spillStore backed by a directory on local disk.
+type localSpillStore struct {
+	dir string
+}
+
+// newLocalSpillStore returns a spillStore rooted at dir. dir is created if
+// it doesn't already exist.
+func newLocalSpillStore(dir string) (*localSpillStore, error) {
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+	return &localSpillStore{dir: dir}, nil
+}
+
+func (s *localSpillStore) path(name string) string {
+	return filepath.Join(s.dir, name)
+}
+
+func (s *localSpillStore) Create(name string) (io.WriteCloser, error) {
+	if err := os.MkdirAll(filepath.Dir(s.path(name)), 0750); err != nil {
+		return nil, err
+	}
+	return os.Create(s.path(name))
+}
+
+func (s *localSpillStore) Open(name string) (spillReadSeekCloser, error) {
+	return os.Open(s.path(name))
+}
+
+func (s *localSpillStore) Remove(name string) error {
+	err := os.Remove(s.path(name))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// List reads only the directory part of prefix (up to its last slash);
+// files in deeper subdirectories are not listed.
+func (s *localSpillStore) List(prefix string) ([]string, error) {
+	dir, base := filepath.Split(prefix)
+	entries, err := ioutil.ReadDir(filepath.Join(s.dir, dir))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if len(e.Name()) >= len(base) && e.Name()[:len(base)] == base {
+			names = append(names, dir+e.Name())
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"io"
+	"strings"
+
+	"cloud.google.com/go/storage"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"golang.org/x/net/context"
+	"google.golang.org/api/iterator"
+)
+
+// s3SpillStore is a spillStore backed by an S3 bucket, for bulk loads whose
+// map output doesn't fit on a single node's scratch space.
+type s3SpillStore struct {
+	bucket   string
+	prefix   string
+	tmpDir   string // where non-seekable GetObject bodies are staged
+	client   *s3.S3
+	uploader *s3manager.Uploader
+}
+
+// newS3SpillStore returns a spillStore that reads and writes objects under
+// prefix in bucket, using sess for authentication. tmpDir is used to back
+// TempFileSeeker when an object body needs to be made seekable.
+func newS3SpillStore(sess *session.Session, bucket, prefix, tmpDir string) *s3SpillStore {
+	return &s3SpillStore{
+		bucket:   bucket,
+		prefix:   prefix,
+		tmpDir:   tmpDir,
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+	}
+}
+
+func (s *s3SpillStore) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *s3SpillStore) Create(name string) (io.WriteCloser, error) {
+	pr, pw := io.Pipe()
+	errCh := make(chan error, 1)
+	go func() {
+		_, err := s.uploader.Upload(&s3manager.UploadInput{
+			Bucket: aws.String(s.bucket),
+			Key:    aws.String(s.key(name)),
+			Body:   pr,
+		})
+		pr.CloseWithError(err)
+		errCh <- err
+	}()
+	return &s3Writer{pw: pw, errCh: errCh}, nil
+}
+
+// s3Writer adapts the io.Pipe feeding s3manager's async Upload to the
+// io.WriteCloser shape spillStore.Create needs; Close blocks until the
+// upload has actually finished so callers can rely on it being durable.
+type s3Writer struct {
+	pw    *io.PipeWriter
+	errCh chan error
+}
+
+func (w *s3Writer) Write(p []byte) (int, error) { return w.pw.Write(p) }
+
+func (w *s3Writer) Close() error {
+	if err := w.pw.Close(); err != nil {
+		return err
+	}
+	return <-w.errCh
+}
+
+func (s *s3SpillStore) Open(name string) (spillReadSeekCloser, error) {
+	out, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer out.Body.Close()
+
+	// S3's GetObject body doesn't support Seek natively, so back it onto a
+	// memory-pool-backed temp file that does.
+	return NewTempFileSeeker(s.tmpDir, out.Body)
+}
+
+func (s *s3SpillStore) Remove(name string) error {
+	_, err := s.client.DeleteObject(&s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(s.key(name)),
+	})
+	return err
+}
+
+func (s *s3SpillStore) List(prefix string) ([]string, error) {
+	var names []string
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(s.key(prefix)),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			names = append(names, strings.TrimPrefix(*obj.Key, s.prefix))
+		}
+		return true
+	})
+	return names, err
+}
+
+// gcsSpillStore is a spillStore backed by a Google Cloud Storage bucket.
+type gcsSpillStore struct {
+	bucket *storage.BucketHandle
+	prefix string
+	tmpDir string
+}
+
+// newGCSSpillStore returns a spillStore that reads and writes objects under
+// prefix in bucket. tmpDir is used to back TempFileSeeker when an object's
+// reader needs to be made seekable.
+func newGCSSpillStore(client *storage.Client, bucket, prefix, tmpDir string) *gcsSpillStore {
+	return &gcsSpillStore{
+		bucket: client.Bucket(bucket),
+		prefix: prefix,
+		tmpDir: tmpDir,
+	}
+}
+
+func (s *gcsSpillStore) key(name string) string {
+	return s.prefix + name
+}
+
+func (s *gcsSpillStore) Create(name string) (io.WriteCloser, error) {
+	return s.bucket.Object(s.key(name)).NewWriter(context.Background()), nil
+}
+
+func (s *gcsSpillStore) Open(name string) (spillReadSeekCloser, error) {
+	r, err := s.bucket.Object(s.key(name)).NewReader(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	// GCS's object reader doesn't support Seek natively, so back it onto a
+	// memory-pool-backed temp file that does.
+	return NewTempFileSeeker(s.tmpDir, r)
+}
+
+func (s *gcsSpillStore) Remove(name string) error {
+	err := s.bucket.Object(s.key(name)).Delete(context.Background())
+	if err == storage.ErrObjectNotExist {
+		return nil
+	}
+	return err
+}
+
+func (s *gcsSpillStore) List(prefix string) ([]string, error) {
+	it := s.bucket.Objects(context.Background(), &storage.Query{Prefix: s.key(prefix)})
+	var names []string
+	for {
+		attrs, err := it.Next()
+		if err == iterator.Done {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, strings.TrimPrefix(attrs.Name, s.prefix))
+	}
+	return names, nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+
+	"github.com/dgraph-io/dgraph/x"
+)
+
+// tempFileBufPool pools the buffers TempFileSeeker uses to decide whether a
+// remote object is small enough to keep in memory, avoiding a disk round
+// trip for the common case of small map-output shards.
+var tempFileBufPool = sync.Pool{
+	New: func() interface{} {
+		return make([]byte, 0, 1<<20) // 1MB
+	},
+}
+
+// tempFileSpillThreshold is the size above which TempFileSeeker spills a
+// non-seekable reader onto a temp file instead of buffering it in memory.
+const tempFileSpillThreshold = 32 << 20 // 32MB
+
+// TempFileSeeker wraps an io.ReadCloser that doesn't support Seek (such as
+// an S3 or GCS object body) and makes it seekable, backing onto a
+// memory-pool-backed buffer for small reads and a real temp file once the
+// object reaches tempFileSpillThreshold. Callers must call Close to
+// return pooled resources and remove any backing temp file.
+type TempFileSeeker struct {
+	buf  []byte // non-nil while small enough to stay in memory
+	file *os.File
+	r    *bytes.Reader // only valid once buf is finalised; nil otherwise
+}
+
+// NewTempFileSeeker drains src into a TempFileSeeker, spilling to a temp
+// file under dir once tempFileSpillThreshold bytes have been read without
+// reaching EOF (so data of exactly that size spills too).
+func NewTempFileSeeker(dir string, src io.Reader) (*TempFileSeeker, error) {
+	buf := tempFileBufPool.Get().([]byte)[:0]
+	t := &TempFileSeeker{buf: buf}
+
+	// Buffer up to tempFileSpillThreshold bytes in memory first, growing
+	// the pooled buffer as needed.
+	for len(t.buf) < tempFileSpillThreshold {
+		if len(t.buf) == cap(t.buf) {
+			t.buf = append(t.buf, 0)[:len(t.buf)]
+		}
+		n, err := src.Read(t.buf[len(t.buf):cap(t.buf)])
+		t.buf = t.buf[:len(t.buf)+n]
+		if err == io.EOF {
+			t.r = bytes.NewReader(t.buf)
+			return t, nil
+		}
+		x.Check(err)
+	}
+
+	// src has at least tempFileSpillThreshold bytes: spill what's been
+	// buffered so far to a real temp file, then stream the remainder of
+	// src straight into it. spill is only ever called once per
+	// TempFileSeeker -- calling it again here would hand back a second,
+	// empty temp file and silently orphan the one just written to.
+	if err := t.spill(dir); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if _, err := io.Copy(t.file, src); err != nil {
+		t.Close()
+		return nil, err
+	}
+	if _, err := t.file.Seek(0, io.SeekStart); err != nil {
+		t.Close()
+		return nil, err
+	}
+	return t, nil
+}
+
+// spill moves the in-memory buffer accumulated so far onto a temp file and
+// releases the pooled buffer back to tempFileBufPool.
+func (t *TempFileSeeker) spill(dir string) error {
+	f, err := ioutil.TempFile(dir, "spill-reader")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(t.buf); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	tempFileBufPool.Put(t.buf[:0])
+	t.buf = nil
+	t.file = f
+	return nil
+}
+
+func (t *TempFileSeeker) Read(p []byte) (int, error) {
+	if t.file != nil {
+		return t.file.Read(p)
+	}
+	return t.r.Read(p)
+}
+
+func (t *TempFileSeeker) Seek(offset int64, whence int) (int64, error) {
+	if t.file != nil {
+		return t.file.Seek(offset, whence)
+	}
+	return t.r.Seek(offset, whence)
+}
+
+// Close releases the pooled buffer (if the data never spilled) or removes
+// the backing temp file (if it did).
+func (t *TempFileSeeker) Close() error {
+	if t.buf != nil {
+		tempFileBufPool.Put(t.buf[:0])
+		t.buf = nil
+	}
+	if t.file != nil {
+		name := t.file.Name()
+		err := t.file.Close()
+		os.Remove(name)
+		return err
+	}
+	return nil
+}